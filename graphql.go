@@ -0,0 +1,291 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// gqlField is one field parsed out of a GraphQL selection set: its name, the
+// alias it should be output under (defaults to Name), its arguments
+// (literals and $variable references already resolved against the request's
+// variables), and its nested selection (nil for scalar fields).
+type gqlField struct {
+	Name string
+	as   string
+	Args map[string]interface{}
+	Sub  []gqlField
+}
+
+// outputKey is the key this field's resolved value is written under in the
+// response - the alias if the client gave one, else the field name.
+func (f gqlField) outputKey() string {
+	if f.as != "" {
+		return f.as
+	}
+	return f.Name
+}
+
+// gqlParser is a tiny hand-rolled recursive-descent parser for exactly the
+// subset of the GraphQL query language this API's schema needs: a single
+// (optionally named) "query" operation containing a selection set of
+// fields, each with optional parenthesized arguments and an optional nested
+// selection set. Fragments, directives, inline unions and multiple
+// operations aren't part of this schema, so they aren't supported.
+type gqlParser struct {
+	src  string
+	pos  int
+	vars map[string]interface{}
+}
+
+// parseGraphQLQuery parses query into its top-level selection set, resolving
+// any $variable argument values against vars as it goes.
+func parseGraphQLQuery(query string, vars map[string]interface{}) ([]gqlField, error) {
+	p := &gqlParser{src: query, vars: vars}
+
+	if p.matchKeyword("query") {
+		p.consumeIdentifierIfPresent()
+	}
+
+	fields, err := p.parseSelectionSet()
+	if err != nil {
+		return nil, err
+	}
+
+	p.skipIgnored()
+	if p.pos < len(p.src) {
+		return nil, fmt.Errorf("graphql: unexpected trailing input at position %d", p.pos)
+	}
+	return fields, nil
+}
+
+func (p *gqlParser) skipIgnored() {
+	for p.pos < len(p.src) {
+		switch p.src[p.pos] {
+		case ' ', '\t', '\n', '\r', ',':
+			p.pos++
+		default:
+			return
+		}
+	}
+}
+
+func (p *gqlParser) peek() byte {
+	if p.pos >= len(p.src) {
+		return 0
+	}
+	return p.src[p.pos]
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isIdentPart(c byte) bool {
+	return isIdentStart(c) || (c >= '0' && c <= '9')
+}
+
+func (p *gqlParser) parseIdentifier() (string, error) {
+	p.skipIgnored()
+	start := p.pos
+	if p.pos >= len(p.src) || !isIdentStart(p.src[p.pos]) {
+		return "", fmt.Errorf("graphql: expected identifier at position %d", p.pos)
+	}
+	for p.pos < len(p.src) && isIdentPart(p.src[p.pos]) {
+		p.pos++
+	}
+	return p.src[start:p.pos], nil
+}
+
+// matchKeyword consumes kw if it appears next as a whole identifier (not a
+// prefix of a longer one), e.g. "query" must not match "queryFoo".
+func (p *gqlParser) matchKeyword(kw string) bool {
+	p.skipIgnored()
+	if !strings.HasPrefix(p.src[p.pos:], kw) {
+		return false
+	}
+	end := p.pos + len(kw)
+	if end < len(p.src) && isIdentPart(p.src[end]) {
+		return false
+	}
+	p.pos = end
+	return true
+}
+
+func (p *gqlParser) consumeIdentifierIfPresent() {
+	p.skipIgnored()
+	if p.pos < len(p.src) && isIdentStart(p.src[p.pos]) {
+		_, _ = p.parseIdentifier()
+	}
+}
+
+func (p *gqlParser) expect(c byte) error {
+	p.skipIgnored()
+	if p.pos >= len(p.src) || p.src[p.pos] != c {
+		return fmt.Errorf("graphql: expected %q at position %d", c, p.pos)
+	}
+	p.pos++
+	return nil
+}
+
+func (p *gqlParser) parseSelectionSet() ([]gqlField, error) {
+	if err := p.expect('{'); err != nil {
+		return nil, err
+	}
+
+	var fields []gqlField
+	for {
+		p.skipIgnored()
+		if p.peek() == '}' {
+			p.pos++
+			return fields, nil
+		}
+		if p.pos >= len(p.src) {
+			return nil, fmt.Errorf("graphql: unterminated selection set")
+		}
+
+		field, err := p.parseField()
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, field)
+	}
+}
+
+func (p *gqlParser) parseField() (gqlField, error) {
+	first, err := p.parseIdentifier()
+	if err != nil {
+		return gqlField{}, err
+	}
+	field := gqlField{Name: first}
+
+	p.skipIgnored()
+	if p.peek() == ':' {
+		p.pos++
+		name, err := p.parseIdentifier()
+		if err != nil {
+			return gqlField{}, err
+		}
+		field.as = first
+		field.Name = name
+	}
+
+	p.skipIgnored()
+	if p.peek() == '(' {
+		args, err := p.parseArguments()
+		if err != nil {
+			return gqlField{}, err
+		}
+		field.Args = args
+	}
+
+	p.skipIgnored()
+	if p.peek() == '{' {
+		sub, err := p.parseSelectionSet()
+		if err != nil {
+			return gqlField{}, err
+		}
+		field.Sub = sub
+	}
+
+	return field, nil
+}
+
+func (p *gqlParser) parseArguments() (map[string]interface{}, error) {
+	if err := p.expect('('); err != nil {
+		return nil, err
+	}
+
+	args := map[string]interface{}{}
+	for {
+		p.skipIgnored()
+		if p.peek() == ')' {
+			p.pos++
+			return args, nil
+		}
+
+		name, err := p.parseIdentifier()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(':'); err != nil {
+			return nil, err
+		}
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		args[name] = value
+	}
+}
+
+func (p *gqlParser) parseValue() (interface{}, error) {
+	p.skipIgnored()
+	if p.pos >= len(p.src) {
+		return nil, fmt.Errorf("graphql: unexpected end of query while parsing a value")
+	}
+
+	c := p.src[p.pos]
+	switch {
+	case c == '$':
+		p.pos++
+		name, err := p.parseIdentifier()
+		if err != nil {
+			return nil, err
+		}
+		return p.vars[name], nil
+	case c == '"':
+		return p.parseStringLiteral()
+	case c == '-' || (c >= '0' && c <= '9'):
+		return p.parseNumberLiteral()
+	case isIdentStart(c):
+		ident, err := p.parseIdentifier()
+		if err != nil {
+			return nil, err
+		}
+		switch ident {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		default:
+			return ident, nil
+		}
+	default:
+		return nil, fmt.Errorf("graphql: unexpected character %q while parsing a value", c)
+	}
+}
+
+func (p *gqlParser) parseStringLiteral() (interface{}, error) {
+	if err := p.expect('"'); err != nil {
+		return nil, err
+	}
+	start := p.pos
+	for p.pos < len(p.src) && p.src[p.pos] != '"' {
+		p.pos++
+	}
+	if p.pos >= len(p.src) {
+		return nil, fmt.Errorf("graphql: unterminated string literal")
+	}
+	value := p.src[start:p.pos]
+	p.pos++
+	return value, nil
+}
+
+func (p *gqlParser) parseNumberLiteral() (interface{}, error) {
+	start := p.pos
+	if p.src[p.pos] == '-' {
+		p.pos++
+	}
+	for p.pos < len(p.src) && ((p.src[p.pos] >= '0' && p.src[p.pos] <= '9') || p.src[p.pos] == '.') {
+		p.pos++
+	}
+	lit := p.src[start:p.pos]
+
+	var f float64
+	if _, err := fmt.Sscanf(lit, "%g", &f); err != nil {
+		return nil, fmt.Errorf("graphql: invalid number literal %q", lit)
+	}
+	return f, nil
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"context"
+	"log"
+	"math/big"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+const (
+	ingestQueueSize     = 2048
+	pollInterval        = 10 * time.Second
+	maxReconnectBackoff = 2 * time.Minute
+)
+
+// Ingester merges a historical FilterLogs backfill with a live log feed
+// (subscription or polling) into a single channel of logs in block order.
+type Ingester struct {
+	client       *ethclient.Client
+	addresses    []common.Address
+	topics       []common.Hash
+	forcePolling bool
+	out          chan types.Log
+}
+
+func NewIngester(client *ethclient.Client, addresses []common.Address, topics []common.Hash, forcePolling bool) *Ingester {
+	return &Ingester{
+		client:       client,
+		addresses:    addresses,
+		topics:       topics,
+		forcePolling: forcePolling,
+		out:          make(chan types.Log, ingestQueueSize),
+	}
+}
+
+// Out returns the merged, block-ordered log stream.
+func (ig *Ingester) Out() <-chan types.Log {
+	return ig.out
+}
+
+// Run backfills [fromBlock, head] via FilterLogs while buffering whatever
+// the live feed produces in the meantime, then replays the buffered live
+// logs in order before switching to forwarding the live feed directly.
+func (ig *Ingester) Run(ctx context.Context, fromBlock, batchSize int64) {
+	live := make(chan types.Log, ingestQueueSize)
+	go ig.subscribeOrPoll(ctx, live)
+
+	head, err := ig.client.BlockNumber(ctx)
+	if err != nil {
+		log.Printf("❌ Ingester: failed to fetch head block, backfill will be skipped: %v", err)
+		head = uint64(fromBlock)
+	}
+
+	var mu sync.Mutex
+	var buffered []types.Log
+	backfillDone := false
+
+	go func() {
+		for lg := range live {
+			mu.Lock()
+			if backfillDone {
+				mu.Unlock()
+				ig.out <- lg
+				continue
+			}
+			buffered = append(buffered, lg)
+			mu.Unlock()
+		}
+	}()
+
+	ig.backfill(ctx, fromBlock, int64(head), batchSize)
+
+	mu.Lock()
+	sort.Slice(buffered, func(i, j int) bool {
+		if buffered[i].BlockNumber != buffered[j].BlockNumber {
+			return buffered[i].BlockNumber < buffered[j].BlockNumber
+		}
+		return buffered[i].Index < buffered[j].Index
+	})
+	for _, lg := range buffered {
+		if lg.BlockNumber > head {
+			ig.out <- lg
+		}
+	}
+	buffered = nil
+	backfillDone = true
+	mu.Unlock()
+}
+
+// backfill walks [from, to] in batchSize windows, prescanning each window's
+// block headers against our watched addresses/topics via their bloom
+// filter so ranges with nothing relevant skip the FilterLogs call entirely.
+func (ig *Ingester) backfill(ctx context.Context, from, to, batchSize int64) {
+	for b := from; b <= to; b += batchSize {
+		end := b + batchSize - 1
+		if end > to {
+			end = to
+		}
+
+		matching := ig.prescanRange(ctx, b, end)
+		if len(matching) == 0 {
+			log.Printf("⏭️ Skipped empty range %d-%d (bloom prescan)", b, end)
+			continue
+		}
+
+		total := 0
+		for _, r := range matching {
+			query := ethereum.FilterQuery{
+				FromBlock: big.NewInt(r.From),
+				ToBlock:   big.NewInt(r.To),
+				Addresses: ig.addresses,
+			}
+
+			logs, err := ig.client.FilterLogs(ctx, query)
+			if err != nil {
+				log.Printf("⚠️ Ingester: backfill FilterLogs %d-%d failed: %v", r.From, r.To, err)
+				continue
+			}
+			for _, lg := range logs {
+				ig.out <- lg
+			}
+			total += len(logs)
+		}
+		log.Printf("✅ Backfilled %d-%d (%d logs)", b, end, total)
+	}
+}
+
+// subscribeOrPoll feeds out with new logs as they arrive, preferring a live
+// websocket subscription and reconnecting with exponential backoff, falling
+// back to polling when the RPC doesn't support subscriptions or polling is
+// forced.
+func (ig *Ingester) subscribeOrPoll(ctx context.Context, out chan<- types.Log) {
+	if ig.forcePolling {
+		ig.poll(ctx, out)
+		return
+	}
+
+	backoff := time.Second
+	var lastDelivered uint64
+	haveLastDelivered := false
+
+	for {
+		if ctx.Err() != nil {
+			return
+		}
+
+		logsCh := make(chan types.Log, ingestQueueSize)
+		query := ethereum.FilterQuery{Addresses: ig.addresses}
+		sub, err := ig.client.SubscribeFilterLogs(ctx, query, logsCh)
+		if err != nil {
+			log.Printf("⚠️ Ingester: subscriptions unavailable (%v), falling back to polling", err)
+			ig.poll(ctx, out)
+			return
+		}
+
+		log.Println("🔹 Ingester: subscribed to live logs")
+
+		for reconnect := false; !reconnect; {
+			select {
+			case <-ctx.Done():
+				sub.Unsubscribe()
+				return
+			case err := <-sub.Err():
+				log.Printf("⚠️ Ingester: subscription dropped (%v), reconnecting in %s", err, backoff)
+				time.Sleep(backoff)
+				if backoff < maxReconnectBackoff {
+					backoff *= 2
+				}
+				if haveLastDelivered {
+					// Re-scan from lastDelivered itself, not +1: we only
+					// know the last delivered log's block, not its log
+					// index within that block, so there may be sibling
+					// logs in the same block the subscription never got to
+					// deliver before it dropped. Re-delivering lastDelivered
+					// itself is harmless - downstream consumers dedup by
+					// (txHash, blockNumber).
+					ig.catchUpGap(ctx, lastDelivered, out)
+				}
+				reconnect = true
+			case lg := <-logsCh:
+				// A delivered log shows the connection is healthy again, so
+				// only then does the reconnect delay start over.
+				backoff = time.Second
+				out <- lg
+				lastDelivered = lg.BlockNumber
+				haveLastDelivered = true
+			}
+		}
+	}
+}
+
+// catchUpGap re-scans [from, head] via FilterLogs to recover whatever logs
+// were emitted while the subscription was down, before the reconnect loop
+// resubscribes and starts trusting the live feed again. Without this, every
+// log emitted during the disconnect/backoff window would be lost silently.
+func (ig *Ingester) catchUpGap(ctx context.Context, from uint64, out chan<- types.Log) {
+	head, err := ig.client.BlockNumber(ctx)
+	if err != nil {
+		log.Printf("⚠️ Ingester: failed to fetch head for reconnect gap catch-up from block %d: %v", from, err)
+		return
+	}
+	if head < from {
+		return
+	}
+
+	query := ethereum.FilterQuery{
+		FromBlock: big.NewInt(int64(from)),
+		ToBlock:   big.NewInt(int64(head)),
+		Addresses: ig.addresses,
+	}
+
+	logs, err := ig.client.FilterLogs(ctx, query)
+	if err != nil {
+		log.Printf("⚠️ Ingester: reconnect gap catch-up FilterLogs %d-%d failed: %v", from, head, err)
+		return
+	}
+	for _, lg := range logs {
+		out <- lg
+	}
+	log.Printf("✅ Recovered %d log(s) from reconnect gap %d-%d", len(logs), from, head)
+}
+
+// poll is the fallback (and forced) path: periodically diff the chain head
+// against the last polled block and FilterLogs the gap.
+func (ig *Ingester) poll(ctx context.Context, out chan<- types.Log) {
+	lastPolled, err := ig.client.BlockNumber(ctx)
+	if err != nil {
+		lastPolled = 0
+	}
+
+	for {
+		if ctx.Err() != nil {
+			return
+		}
+		time.Sleep(pollInterval)
+
+		head, err := ig.client.BlockNumber(ctx)
+		if err != nil || head <= lastPolled {
+			continue
+		}
+
+		query := ethereum.FilterQuery{
+			FromBlock: big.NewInt(int64(lastPolled + 1)),
+			ToBlock:   big.NewInt(int64(head)),
+			Addresses: ig.addresses,
+		}
+
+		logs, err := ig.client.FilterLogs(ctx, query)
+		if err != nil {
+			continue
+		}
+		for _, lg := range logs {
+			out <- lg
+		}
+		lastPolled = head
+	}
+}
+
+// forcePollingFromEnv lets operators force the batch-polling path even when
+// the RPC endpoint supports subscriptions, e.g. for RPC providers with flaky
+// websocket support.
+func forcePollingFromEnv() bool {
+	return os.Getenv("FORCE_POLLING") == "true"
+}
+
+// apiAddrFromEnv is the listen address for the REST/GraphQL read API.
+func apiAddrFromEnv() string {
+	if addr := os.Getenv("API_ADDR"); addr != "" {
+		return addr
+	}
+	return ":8080"
+}
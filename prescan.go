@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"math/big"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Tunables for the bloom prescan, overridable via env vars so an operator
+// can trade RPC load for prescan accuracy without a redeploy.
+const (
+	defaultPrescanConcurrency = 8
+	defaultPrescanMergeGap    = 5
+)
+
+func prescanConcurrency() int {
+	if v, err := strconv.Atoi(os.Getenv("PRESCAN_CONCURRENCY")); err == nil && v > 0 {
+		return v
+	}
+	return defaultPrescanConcurrency
+}
+
+func prescanMergeGap() int64 {
+	if v, err := strconv.ParseInt(os.Getenv("PRESCAN_MERGE_GAP"), 10, 64); err == nil && v >= 0 {
+		return v
+	}
+	return defaultPrescanMergeGap
+}
+
+// blockRange is an inclusive [From, To] block range.
+type blockRange struct {
+	From int64
+	To   int64
+}
+
+// bloomMatches reports whether a block's header bloom could contain a log
+// from one of our watched addresses carrying one of our watched topics.
+// Bloom filters never false-negative, so this is safe to use to skip a
+// block outright; it may false-positive, which just costs an extra
+// FilterLogs call.
+func bloomMatches(bloom types.Bloom, addresses []common.Address, topics []common.Hash) bool {
+	addrMatch := false
+	for _, addr := range addresses {
+		if types.BloomLookup(bloom, addr) {
+			addrMatch = true
+			break
+		}
+	}
+	if !addrMatch {
+		return false
+	}
+	if len(topics) == 0 {
+		return true
+	}
+	for _, topic := range topics {
+		if types.BloomLookup(bloom, topic) {
+			return true
+		}
+	}
+	return false
+}
+
+// prescanRange fetches headers for [from, to] concurrently and returns the
+// block numbers whose bloom filter indicates a possible match, collapsed
+// into contiguous-ish ranges (small gaps are bridged so a sparse chain
+// doesn't turn into hundreds of single-block FilterLogs calls).
+func (ig *Ingester) prescanRange(ctx context.Context, from, to int64) []blockRange {
+	n := int(to - from + 1)
+	possiblyMatching := make([]bool, n)
+
+	type job struct {
+		idx   int
+		block int64
+	}
+	jobs := make(chan job, n)
+	var wg sync.WaitGroup
+
+	for w := 0; w < prescanConcurrency(); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				header, err := ig.client.HeaderByNumber(ctx, big.NewInt(j.block))
+				if err != nil {
+					// Can't verify; fail open rather than silently skip real logs.
+					possiblyMatching[j.idx] = true
+					continue
+				}
+				possiblyMatching[j.idx] = bloomMatches(header.Bloom, ig.addresses, ig.topics)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		jobs <- job{idx: i, block: from + int64(i)}
+	}
+	close(jobs)
+	wg.Wait()
+
+	var matches []int64
+	for i, m := range possiblyMatching {
+		if m {
+			matches = append(matches, from+int64(i))
+		}
+	}
+	return collapseRanges(matches, prescanMergeGap())
+}
+
+// collapseRanges merges a sorted list of block numbers into inclusive
+// ranges, bridging gaps of up to mergeGap blocks into a single range so a
+// handful of scattered matches don't become a FilterLogs call each.
+func collapseRanges(blocks []int64, mergeGap int64) []blockRange {
+	if len(blocks) == 0 {
+		return nil
+	}
+
+	ranges := []blockRange{{From: blocks[0], To: blocks[0]}}
+	for _, b := range blocks[1:] {
+		last := &ranges[len(ranges)-1]
+		// b-last.To is the block distance, not the gap between them - two
+		// strictly adjacent blocks (b == last.To+1) are 1 apart but have a
+		// gap of 0, so mergeGap needs a +1 to bridge adjacency at all.
+		if b-last.To <= mergeGap+1 {
+			last.To = b
+			continue
+		}
+		ranges = append(ranges, blockRange{From: b, To: b})
+	}
+	return ranges
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func TestBloomMatches(t *testing.T) {
+	addr := common.HexToAddress("0x0000000000000000000000000000000000000001")
+	otherAddr := common.HexToAddress("0x0000000000000000000000000000000000000002")
+	topic := common.HexToHash("0xaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa")
+	otherTopic := common.HexToHash("0xbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb")
+
+	var bloom types.Bloom
+	bloom.Add(addr.Bytes())
+	bloom.Add(topic.Bytes())
+
+	tests := []struct {
+		name      string
+		addresses []common.Address
+		topics    []common.Hash
+		want      bool
+	}{
+		{"matching address, no topics required", []common.Address{addr}, nil, true},
+		{"matching address and matching topic", []common.Address{addr}, []common.Hash{topic}, true},
+		{"matching address but non-matching topic", []common.Address{addr}, []common.Hash{otherTopic}, false},
+		{"non-matching address", []common.Address{otherAddr}, nil, false},
+		{"one of several watched addresses matches", []common.Address{otherAddr, addr}, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := bloomMatches(bloom, tt.addresses, tt.topics); got != tt.want {
+				t.Errorf("bloomMatches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCollapseRanges(t *testing.T) {
+	tests := []struct {
+		name     string
+		blocks   []int64
+		mergeGap int64
+		want     []blockRange
+	}{
+		{"no matches", nil, 5, nil},
+		{"single block", []int64{10}, 5, []blockRange{{From: 10, To: 10}}},
+		{"contiguous blocks merge", []int64{10, 11, 12}, 5, []blockRange{{From: 10, To: 12}}},
+		{"gap within mergeGap bridges", []int64{10, 14, 18}, 5, []blockRange{{From: 10, To: 18}}},
+		{"gap beyond mergeGap splits", []int64{10, 20}, 5, []blockRange{{From: 10, To: 10}, {From: 20, To: 20}}},
+		{"zero mergeGap only merges adjacent", []int64{10, 11, 13}, 0, []blockRange{{From: 10, To: 11}, {From: 13, To: 13}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := collapseRanges(tt.blocks, tt.mergeGap)
+			if len(got) != len(tt.want) {
+				t.Fatalf("collapseRanges() = %+v, want %+v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("collapseRanges() = %+v, want %+v", got, tt.want)
+				}
+			}
+		})
+	}
+}
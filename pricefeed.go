@@ -0,0 +1,56 @@
+package main
+
+import (
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// PriceFeedSubsystem watches PRICE_FEED and keeps the cached collateral
+// price (and liquidation threshold, when the event carries one) up to date,
+// triggering an active-position risk rescan on every update so a price move
+// alone can surface a risk-bucket transition.
+type PriceFeedSubsystem struct {
+	address common.Address
+	abi     abi.ABI
+}
+
+func NewPriceFeedSubsystem() (*PriceFeedSubsystem, error) {
+	priceFeedABI, err := abi.JSON(strings.NewReader(loadABI("abi/PriceFeed.json")))
+	if err != nil {
+		return nil, err
+	}
+
+	return &PriceFeedSubsystem{
+		address: common.HexToAddress("0x1f9866230b44d610d4fc66fdd742312D59c81355"),
+		abi:     priceFeedABI,
+	}, nil
+}
+
+func (p *PriceFeedSubsystem) Name() string { return "price-feed" }
+
+func (p *PriceFeedSubsystem) Addresses() []common.Address {
+	return []common.Address{p.address}
+}
+
+func (p *PriceFeedSubsystem) ABI() abi.ABI { return p.abi }
+
+func (p *PriceFeedSubsystem) Handle(ev ContractEvent) error {
+	if ev.Name != "PriceFeedUpdated" {
+		return nil
+	}
+
+	if price, ok := ev.Data["_price"].(*big.Int); ok {
+		setCachedPrice(bigIntToFloat(price))
+	}
+	if threshold, ok := ev.Data["_liquidationThreshold"].(*big.Int); ok {
+		setLiquidationThreshold(bigIntToFloat(threshold))
+	}
+
+	// The risk rescan this event should trigger is wired through the Bus
+	// (see subscribeRiskToBus) rather than called directly here, so the risk
+	// subsystem doesn't need a hard dependency on price-feed.
+	return nil
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"log"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// reorgWindowSize is how many recently processed blocks we keep hashes for,
+// so we can detect a reorg and find the common ancestor with the new chain.
+const reorgWindowSize = 64
+
+// finalityDepth is how many blocks behind the head must pass before a
+// checkpoint is considered safe to delete.
+const finalityDepth = 64
+
+var checkpointColl *mongo.Collection
+
+// blockRef is a lightweight record of a processed block, kept around long
+// enough to detect a reorg.
+type blockRef struct {
+	Number     uint64
+	Hash       common.Hash
+	ParentHash common.Hash
+}
+
+// PositionCheckpoint stores the pre-image of a Position document immediately
+// before it was mutated by a given block, so a reorg rollback can restore it.
+type PositionCheckpoint struct {
+	PositionID  int      `bson:"positionID"`
+	BlockNumber uint64   `bson:"blockNumber"`
+	Existed     bool     `bson:"existed"`
+	Position    Position `bson:"position"`
+}
+
+// appendBlock records a processed block in the sliding window, trimming the
+// oldest entries once the window exceeds reorgWindowSize.
+func appendBlock(window []blockRef, ref blockRef) []blockRef {
+	window = append(window, ref)
+	if len(window) > reorgWindowSize {
+		window = window[len(window)-reorgWindowSize:]
+	}
+	return window
+}
+
+// trimWindow drops every entry above the given ancestor block, used
+// after a rollback so stale block hashes aren't compared again.
+func trimWindow(window []blockRef, ancestor uint64) []blockRef {
+	trimmed := window[:0]
+	for _, ref := range window {
+		if ref.Number <= ancestor {
+			trimmed = append(trimmed, ref)
+		}
+	}
+	return trimmed
+}
+
+// checkReorg compares the tip of our recorded window against the current
+// canonical chain. If the hashes diverge, it walks the window backwards to
+// find the most recent block both chains agree on.
+func checkReorg(ctx context.Context, client *ethclient.Client, window []blockRef) (ancestor uint64, reorged bool, err error) {
+	if len(window) == 0 {
+		return 0, false, nil
+	}
+
+	tip := window[len(window)-1]
+	header, err := client.HeaderByNumber(ctx, new(big.Int).SetUint64(tip.Number))
+	if err != nil {
+		return 0, false, err
+	}
+	if header.Hash() == tip.Hash {
+		return 0, false, nil
+	}
+
+	for i := len(window) - 1; i >= 0; i-- {
+		h, err := client.HeaderByNumber(ctx, new(big.Int).SetUint64(window[i].Number))
+		if err != nil {
+			continue
+		}
+		if h.Hash() == window[i].Hash {
+			return window[i].Number, true, nil
+		}
+	}
+
+	// The reorg goes deeper than our tracked window: no entry we still hold
+	// a hash for matches the canonical chain, so window[0] - the one entry
+	// we just confirmed has diverged - is not a confirmed common ancestor,
+	// just the oldest block we still have checkpoints for. This exceeds what
+	// reorgWindowSize was sized to handle and needs an operator's attention;
+	// alarm loudly and roll back to it only as a best-effort guess.
+	log.Printf("❌ Reorg exceeded tracked window of %d blocks: no common ancestor found, falling back to unverified block %d - manual verification required", reorgWindowSize, window[0].Number)
+	return window[0].Number, true, nil
+}
+
+// saveCheckpoint records the pre-mutation state of a position so it can be
+// restored if the block that's about to update it gets reorged out.
+func saveCheckpoint(positionID int, blockNumber uint64, existed bool, position Position) error {
+	doc := PositionCheckpoint{
+		PositionID:  positionID,
+		BlockNumber: blockNumber,
+		Existed:     existed,
+		Position:    position,
+	}
+	_, err := checkpointColl.UpdateOne(
+		context.TODO(),
+		bson.M{"positionID": positionID, "blockNumber": blockNumber},
+		bson.M{"$setOnInsert": doc},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+// rollbackToBlock undoes every position mutation that happened after
+// ancestor, restoring each affected position from the checkpoint of the
+// first mutation after ancestor (or deleting it if that checkpoint says it
+// didn't exist yet at that block), then trims history entries from the
+// abandoned fork.
+func rollbackToBlock(ancestor uint64) error {
+	ctx := context.TODO()
+
+	cursor, err := checkpointColl.Find(ctx, bson.M{"blockNumber": bson.M{"$gt": ancestor}})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	affected := map[int]bool{}
+	for cursor.Next(ctx) {
+		var cp PositionCheckpoint
+		if err := cursor.Decode(&cp); err != nil {
+			continue
+		}
+		affected[cp.PositionID] = true
+	}
+
+	for positionID := range affected {
+		restored, err := nearestCheckpoint(ctx, positionID, ancestor)
+		if err == mongo.ErrNoDocuments {
+			// No checkpoint survives after ancestor for this position at all
+			// (shouldn't happen, since affected was built from exactly these
+			// checkpoints) - nothing we can trust it to be as of ancestor,
+			// so treat it like it never existed.
+			if _, delErr := positionColl.DeleteOne(ctx, bson.M{"positionID": positionID}); delErr != nil {
+				log.Printf("⚠️ Rollback: failed to delete position %d with no surviving checkpoint: %v", positionID, delErr)
+			}
+			continue
+		}
+		if err != nil {
+			log.Printf("⚠️ Rollback: failed to fetch checkpoint for position %d after block %d: %v", positionID, ancestor, err)
+			continue
+		}
+
+		if !restored.Existed {
+			if _, err := positionColl.DeleteOne(ctx, bson.M{"positionID": positionID}); err != nil {
+				log.Printf("⚠️ Rollback: failed to delete position %d: %v", positionID, err)
+			}
+			continue
+		}
+
+		trimmedHistory := make([]HistoryEntry, 0, len(restored.Position.History))
+		for _, h := range restored.Position.History {
+			if h.BlockNumber <= ancestor {
+				trimmedHistory = append(trimmedHistory, h)
+			}
+		}
+		restored.Position.History = trimmedHistory
+
+		_, err = positionColl.ReplaceOne(ctx, bson.M{"positionID": positionID}, restored.Position, options.Replace().SetUpsert(true))
+		if err != nil {
+			log.Printf("⚠️ Rollback: failed to restore position %d: %v", positionID, err)
+		}
+	}
+
+	_, err = checkpointColl.DeleteMany(ctx, bson.M{"blockNumber": bson.M{"$gt": ancestor}})
+	return err
+}
+
+// nearestCheckpoint returns the checkpoint for positionID with the smallest
+// blockNumber > at. A checkpoint is keyed by the block of the mutation it's
+// a pre-image *for*, so it's valid starting at that block - the pre-image
+// that restores "state as of at" is the one belonging to the *first*
+// mutation after at, not the last one at or before it.
+func nearestCheckpoint(ctx context.Context, positionID int, at uint64) (PositionCheckpoint, error) {
+	opts := options.FindOne().SetSort(bson.D{{Key: "blockNumber", Value: 1}})
+	var cp PositionCheckpoint
+	err := checkpointColl.FindOne(ctx, bson.M{"positionID": positionID, "blockNumber": bson.M{"$gt": at}}, opts).Decode(&cp)
+	return cp, err
+}
+
+// pruneFinalizedCheckpoints deletes checkpoints older than finalityDepth
+// blocks behind the current head, since those blocks can no longer reorg.
+func pruneFinalizedCheckpoints(head uint64) {
+	if head < finalityDepth {
+		return
+	}
+	cutoff := head - finalityDepth
+	_, err := checkpointColl.DeleteMany(context.TODO(), bson.M{"blockNumber": bson.M{"$lte": cutoff}})
+	if err != nil {
+		log.Printf("⚠️ Failed to prune finalized checkpoints: %v", err)
+	}
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	kafka "github.com/segmentio/kafka-go"
+)
+
+// RiskBucket classifies how close a position is to liquidation.
+type RiskBucket string
+
+const (
+	RiskSafe         RiskBucket = "safe"
+	RiskWarn         RiskBucket = "warn"
+	RiskDanger       RiskBucket = "danger"
+	RiskLiquidatable RiskBucket = "liquidatable"
+)
+
+const (
+	riskWarnThreshold           = 80.0
+	riskDangerThreshold         = 90.0
+	defaultLiquidationThreshold = 110.0
+	defaultCollateralPrice      = 1.0
+)
+
+var riskEventsColl *mongo.Collection
+
+var (
+	priceMu               sync.RWMutex
+	cachedPrice           = defaultCollateralPrice
+	liquidationThresholdV = defaultLiquidationThreshold
+)
+
+func currentPrice() float64 {
+	priceMu.RLock()
+	defer priceMu.RUnlock()
+	return cachedPrice
+}
+
+func setCachedPrice(p float64) {
+	if p <= 0 {
+		return
+	}
+	priceMu.Lock()
+	defer priceMu.Unlock()
+	cachedPrice = p
+}
+
+func liquidationThreshold() float64 {
+	priceMu.RLock()
+	defer priceMu.RUnlock()
+	return liquidationThresholdV
+}
+
+func setLiquidationThreshold(v float64) {
+	if v <= 0 {
+		return
+	}
+	priceMu.Lock()
+	defer priceMu.Unlock()
+	liquidationThresholdV = v
+}
+
+// classifyRisk buckets an NLTV reading against the warn/danger/liquidation thresholds.
+func classifyRisk(nltv float64) RiskBucket {
+	switch {
+	case nltv >= liquidationThreshold():
+		return RiskLiquidatable
+	case nltv >= riskDangerThreshold:
+		return RiskDanger
+	case nltv >= riskWarnThreshold:
+		return RiskWarn
+	default:
+		return RiskSafe
+	}
+}
+
+// RiskEvent is the payload recorded to RiskEvents and handed to notifiers
+// whenever a position crosses a risk bucket boundary.
+type RiskEvent struct {
+	PositionID    int        `bson:"positionID" json:"positionID"`
+	WalletAddress string     `bson:"wallet" json:"wallet"`
+	Asset         string     `bson:"asset" json:"asset"`
+	PrevBucket    RiskBucket `bson:"prevBucket" json:"prevBucket"`
+	NewBucket     RiskBucket `bson:"newBucket" json:"newBucket"`
+	Nltv          float64    `bson:"nltv" json:"nltv"`
+	BlockNumber   uint64     `bson:"blockNumber" json:"blockNumber"`
+	TxHash        string     `bson:"txHash" json:"txHash"`
+	Timestamp     string     `bson:"timestamp" json:"timestamp"`
+}
+
+// Notifier fans a risk transition out to an external system.
+type Notifier interface {
+	Notify(ctx context.Context, ev RiskEvent) error
+}
+
+// MultiNotifier fans out to every configured notifier, logging (not
+// failing) individual notifier errors so one bad sink doesn't block others.
+type MultiNotifier []Notifier
+
+func (m MultiNotifier) Notify(ctx context.Context, ev RiskEvent) error {
+	for _, n := range m {
+		if err := n.Notify(ctx, ev); err != nil {
+			log.Printf("⚠️ risk notifier failed: %v", err)
+		}
+	}
+	return nil
+}
+
+// WebhookNotifier POSTs the risk event as JSON to a configured URL.
+type WebhookNotifier struct {
+	url    string
+	client *http.Client
+}
+
+func NewWebhookNotifier(url string) *WebhookNotifier {
+	return &WebhookNotifier{url: url, client: &http.Client{Timeout: 5 * time.Second}}
+}
+
+func (w *WebhookNotifier) Notify(ctx context.Context, ev RiskEvent) error {
+	payload, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook %s returned %d", w.url, resp.StatusCode)
+	}
+	return nil
+}
+
+// KafkaNotifier publishes the risk event to a Kafka topic, keyed by position ID.
+type KafkaNotifier struct {
+	writer *kafka.Writer
+}
+
+func NewKafkaNotifier(brokers []string, topic string) *KafkaNotifier {
+	return &KafkaNotifier{
+		writer: &kafka.Writer{
+			Addr:     kafka.TCP(brokers...),
+			Topic:    topic,
+			Balancer: &kafka.LeastBytes{},
+		},
+	}
+}
+
+func (k *KafkaNotifier) Notify(ctx context.Context, ev RiskEvent) error {
+	payload, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	return k.writer.WriteMessages(ctx, kafka.Message{
+		Key:   []byte(strconv.Itoa(ev.PositionID)),
+		Value: payload,
+	})
+}
+
+// riskNotifier is the process-wide fan-out target, built from env config in main().
+var riskNotifier Notifier = MultiNotifier(nil)
+
+// notifiersFromEnv wires up whichever notifiers are configured via
+// RISK_WEBHOOK_URL / RISK_KAFKA_BROKERS+RISK_KAFKA_TOPIC.
+func notifiersFromEnv() Notifier {
+	var notifiers MultiNotifier
+	if url := os.Getenv("RISK_WEBHOOK_URL"); url != "" {
+		notifiers = append(notifiers, NewWebhookNotifier(url))
+	}
+	if brokers := os.Getenv("RISK_KAFKA_BROKERS"); brokers != "" {
+		topic := os.Getenv("RISK_KAFKA_TOPIC")
+		if topic == "" {
+			topic = "risk-events"
+		}
+		notifiers = append(notifiers, NewKafkaNotifier(strings.Split(brokers, ","), topic))
+	}
+	return notifiers
+}
+
+// recordRiskTransition persists the transition and fans it out. No-op if
+// prevBucket == newBucket.
+func recordRiskTransition(pos Position, prevBucket, newBucket RiskBucket, txHash string) {
+	if prevBucket == newBucket {
+		return
+	}
+
+	ev := RiskEvent{
+		PositionID:    pos.PositionID,
+		WalletAddress: pos.WalletAddress,
+		Asset:         pos.Asset,
+		PrevBucket:    prevBucket,
+		NewBucket:     newBucket,
+		Nltv:          pos.Nltv,
+		BlockNumber:   pos.BlockNumber,
+		TxHash:        txHash,
+		Timestamp:     time.Now().Format(time.RFC3339),
+	}
+
+	if _, err := riskEventsColl.InsertOne(context.TODO(), ev); err != nil {
+		log.Printf("⚠️ Failed to record risk event for position %d: %v", pos.PositionID, err)
+	}
+
+	if err := riskNotifier.Notify(context.TODO(), ev); err != nil {
+		log.Printf("⚠️ Failed to notify risk event for position %d: %v", pos.PositionID, err)
+	}
+}
+
+// subscribeRiskToBus wires the risk subsystem to the event bus so it reacts
+// to a PriceFeedUpdated event from the price-feed subsystem without a direct
+// dependency on it, per the Subsystem/Bus design: anything any subsystem
+// publishes, the risk subsystem can observe just by listening.
+func subscribeRiskToBus(bus *Bus) {
+	ch := make(chan ContractEvent, 16)
+	bus.Subscribe(ch)
+
+	go func() {
+		for ev := range ch {
+			if ev.Name != "PriceFeedUpdated" {
+				continue
+			}
+			if err := rescanActivePositionsRisk(ev.RawLog.TxHash.Hex(), ev.RawLog.BlockNumber); err != nil {
+				log.Printf("⚠️ risk rescan failed for PriceFeedUpdated at block %d: %v", ev.RawLog.BlockNumber, err)
+			}
+		}
+	}()
+}
+
+// rescanActivePositionsRisk recomputes NLTV for every active position using
+// the latest cached price, so risk transitions driven purely by a price
+// move (no Trove event for that position) are still detected. triggerTxHash
+// and triggerBlock identify the PriceFeedUpdated event that caused the scan.
+func rescanActivePositionsRisk(triggerTxHash string, triggerBlock uint64) error {
+	ctx := context.TODO()
+	cursor, err := positionColl.Find(ctx, bson.M{"status": "active"})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var pos Position
+		if err := cursor.Decode(&pos); err != nil {
+			continue
+		}
+
+		newNltv := calculateNLTV(pos.Debt, pos.Coll)
+		prevBucket := classifyRisk(pos.Nltv)
+		newBucket := classifyRisk(newNltv)
+
+		if _, err := positionColl.UpdateOne(ctx, bson.M{"positionID": pos.PositionID}, bson.M{"$set": bson.M{"nltv": newNltv}}); err != nil {
+			log.Printf("⚠️ risk rescan: failed to update nltv for position %d: %v", pos.PositionID, err)
+			continue
+		}
+
+		pos.Nltv = newNltv
+		pos.BlockNumber = triggerBlock
+		recordRiskTransition(pos, prevBucket, newBucket, triggerTxHash)
+	}
+	return nil
+}
+
+// ensureRiskIndexes creates the index the at-risk scan and bucket-transition
+// lookups rely on.
+func ensureRiskIndexes() {
+	_, err := positionColl.Indexes().CreateOne(context.TODO(), mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "status", Value: 1},
+			{Key: "nltv", Value: -1},
+		},
+	})
+	if err != nil {
+		log.Printf("⚠️ Failed to ensure risk index: %v", err)
+	}
+}
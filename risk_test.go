@@ -0,0 +1,33 @@
+package main
+
+import "testing"
+
+func TestClassifyRisk(t *testing.T) {
+	// classifyRisk reads the package-level liquidationThreshold, which
+	// setLiquidationThreshold mutates elsewhere; pin it to the default so
+	// this test doesn't depend on run order against other tests.
+	setLiquidationThreshold(defaultLiquidationThreshold)
+
+	tests := []struct {
+		name string
+		nltv float64
+		want RiskBucket
+	}{
+		{"well under warn threshold", 10, RiskSafe},
+		{"just under warn threshold", riskWarnThreshold - 0.01, RiskSafe},
+		{"at warn threshold", riskWarnThreshold, RiskWarn},
+		{"between warn and danger thresholds", 85, RiskWarn},
+		{"at danger threshold", riskDangerThreshold, RiskDanger},
+		{"between danger and liquidation thresholds", 100, RiskDanger},
+		{"at liquidation threshold", defaultLiquidationThreshold, RiskLiquidatable},
+		{"above liquidation threshold", 150, RiskLiquidatable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classifyRisk(tt.nltv); got != tt.want {
+				t.Errorf("classifyRisk(%v) = %v, want %v", tt.nltv, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/event"
+)
+
+// Subsystem lets a self-contained piece of business logic (trove positions
+// and the price feed today; stability-pool, liquidations tomorrow) plug into the
+// ingest loop without the dispatcher knowing anything about it beyond which
+// addresses and ABI it owns.
+type Subsystem interface {
+	// Name identifies the subsystem in logs and metrics.
+	Name() string
+	// Addresses are the contract addresses this subsystem wants logs for.
+	Addresses() []common.Address
+	// ABI is used to match a log's topic to an event name and unpack it.
+	ABI() abi.ABI
+	// Handle processes one already-decoded event owned by this subsystem.
+	Handle(ev ContractEvent) error
+}
+
+// Bus fans a decoded ContractEvent out to any interested subscriber, modeled
+// on go-ethereum's event.Feed/TypeMux so subsystems that only want to
+// observe events (e.g. a risk subsystem reacting to a PriceFeedUpdated
+// emitted by a different subsystem) don't need a hard dependency on the
+// subsystem that owns the event.
+type Bus struct {
+	feed event.Feed
+}
+
+// Publish sends ev to every current subscriber and returns how many received it.
+func (b *Bus) Publish(ev ContractEvent) int {
+	return b.feed.Send(ev)
+}
+
+// Subscribe registers ch to receive every event published on the bus.
+func (b *Bus) Subscribe(ch chan<- ContractEvent) event.Subscription {
+	return b.feed.Subscribe(ch)
+}
+
+// mergeEvents combines the event sets of multiple ABIs into one, for
+// subsystems that watch more than one contract (e.g. trove watches both
+// TroveManager and BorrowerOperations). Event names must be unique across
+// the merged ABIs: a collision would silently drop one contract's event from
+// the map, and indexer.go matches a log's topic only against the events in
+// this map, so that event's logs would stop being recognized with no error
+// at all. Fail fast
+// at merge time instead.
+func mergeEvents(abis ...abi.ABI) (abi.ABI, error) {
+	merged := abi.ABI{Events: map[string]abi.Event{}}
+	for _, a := range abis {
+		for name, event := range a.Events {
+			if _, exists := merged.Events[name]; exists {
+				return abi.ABI{}, fmt.Errorf("mergeEvents: duplicate event name %q across merged ABIs", name)
+			}
+			merged.Events[name] = event
+		}
+	}
+	return merged, nil
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"log"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// defaultStartBlock is where we start scanning from when no SyncState has
+// been persisted yet (i.e. a brand-new deployment).
+const defaultStartBlock = int64(3772000)
+
+// syncStateKey identifies the cursor document. The ingester merges every
+// registered subsystem's contract streams into one ordered feed, so a
+// single cursor tracks them all; the `contract` field is kept so a future
+// per-subsystem cursor (see Subsystem-based dispatch) can reuse this schema.
+const syncStateKey = "trove-indexer"
+
+var syncStateColl *mongo.Collection
+
+// SyncState is the persisted processing cursor, updated after every event so
+// a restart resumes instead of re-scanning from genesis.
+type SyncState struct {
+	Contract              string `bson:"contract"`
+	LastProcessedBlock    uint64 `bson:"lastProcessedBlock"`
+	LastProcessedTxIndex  uint   `bson:"lastProcessedTxIndex"`
+	LastProcessedLogIndex uint   `bson:"lastProcessedLogIndex"`
+}
+
+// loadSyncState returns the persisted cursor, or a fresh one seeded at
+// defaultStartBlock if this is the first run.
+func loadSyncState() SyncState {
+	var state SyncState
+	err := syncStateColl.FindOne(context.TODO(), bson.M{"contract": syncStateKey}).Decode(&state)
+	if err != nil {
+		return SyncState{Contract: syncStateKey, LastProcessedBlock: uint64(defaultStartBlock)}
+	}
+	return state
+}
+
+// saveSyncState atomically persists the cursor after an event has been
+// handled, so a crash mid-stream resumes from the last fully-processed log
+// rather than re-scanning the whole range.
+func saveSyncState(blockNumber uint64, txIndex, logIndex uint) error {
+	_, err := syncStateColl.UpdateOne(
+		context.TODO(),
+		bson.M{"contract": syncStateKey},
+		bson.M{"$set": bson.M{
+			"lastProcessedBlock":    blockNumber,
+			"lastProcessedTxIndex":  txIndex,
+			"lastProcessedLogIndex": logIndex,
+		}},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+// reindexFrom resets the cursor to block-1 and purges every position
+// mutation at or after block, so the next run re-derives them from the
+// chain instead of layering replayed history on top of stale state.
+func reindexFrom(block uint64) error {
+	ctx := context.TODO()
+
+	_, err := syncStateColl.UpdateOne(
+		ctx,
+		bson.M{"contract": syncStateKey},
+		bson.M{"$set": bson.M{
+			"lastProcessedBlock":    block - 1,
+			"lastProcessedTxIndex":  0,
+			"lastProcessedLogIndex": 0,
+		}},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		return err
+	}
+
+	cursor, err := positionColl.Find(ctx, bson.M{"blockNumber": bson.M{"$gte": block}})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var pos Position
+		if err := cursor.Decode(&pos); err != nil {
+			continue
+		}
+
+		kept := make([]HistoryEntry, 0, len(pos.History))
+		for _, h := range pos.History {
+			if h.BlockNumber < block {
+				kept = append(kept, h)
+			}
+		}
+
+		if len(kept) == 0 {
+			if _, err := positionColl.DeleteOne(ctx, bson.M{"positionID": pos.PositionID}); err != nil {
+				log.Printf("⚠️ reindex: failed to purge position %d: %v", pos.PositionID, err)
+			}
+			continue
+		}
+
+		last := kept[len(kept)-1]
+		// Mirrors handlePositionUpdate's status rule (trove.go): a close is
+		// "closed" even though it leaves debt at 0, not "liquidated".
+		status := "active"
+		if last.TxType == "closeTrove" {
+			status = "closed"
+		} else if last.Debt == 0 {
+			status = "liquidated"
+		}
+		update := bson.M{"$set": bson.M{
+			"coll":        last.Coll,
+			"debt":        last.Debt,
+			"nltv":        calculateNLTV(last.Debt, last.Coll),
+			"status":      status,
+			"blockNumber": last.BlockNumber,
+			"history":     kept,
+		}}
+		if _, err := positionColl.UpdateOne(ctx, bson.M{"positionID": pos.PositionID}, update); err != nil {
+			log.Printf("⚠️ reindex: failed to trim position %d: %v", pos.PositionID, err)
+		}
+	}
+
+	_, err = checkpointColl.DeleteMany(ctx, bson.M{"blockNumber": bson.M{"$gte": block}})
+	return err
+}
+
+// ensureIndexes creates the indexes the indexer relies on for idempotent
+// replays; safe to call on every boot since CreateOne is a no-op when an
+// equivalent index already exists.
+func ensureIndexes() {
+	_, err := positionColl.Indexes().CreateOne(context.TODO(), mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "positionID", Value: 1},
+			{Key: "history.txHash", Value: 1},
+			{Key: "history.blockNumber", Value: 1},
+		},
+		Options: options.Index().SetUnique(true).SetSparse(true),
+	})
+	if err != nil {
+		log.Printf("⚠️ Failed to ensure position history index: %v", err)
+	}
+}
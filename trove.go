@@ -0,0 +1,274 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// errDuplicateHistoryEntry signals that handlePositionUpdate skipped a
+// replayed txHash it had already recorded, as distinct from a genuine
+// successful update - returning it alongside a zero-value Position keeps
+// that skip from being mistaken for "updated position, NLTV 0".
+var errDuplicateHistoryEntry = errors.New("trove: history entry already recorded, skipping")
+
+// ------------------ Mongo Structs ------------------
+
+type HistoryEntry struct {
+	TxHash      string  `bson:"txHash"`
+	Coll        float64 `bson:"coll"`
+	Debt        float64 `bson:"debt"`
+	TxType      string  `bson:"txType"`
+	Timestamp   string  `bson:"timestamp"`
+	BlockNumber uint64  `bson:"blockNumber"`
+}
+
+type Position struct {
+	PositionID    int            `bson:"positionID"`
+	WalletAddress string         `bson:"walletAddress"`
+	Asset         string         `bson:"asset"`
+	Coll          float64        `bson:"coll"`
+	Debt          float64        `bson:"debt"`
+	Status        string         `bson:"status"`
+	Nltv          float64        `bson:"nltv"`
+	BlockNumber   uint64         `bson:"blockNumber"`
+	History       []HistoryEntry `bson:"history"`
+}
+
+var (
+	positionColl *mongo.Collection
+	historyColl  *mongo.Collection
+)
+
+// ------------------ Helpers ------------------
+
+func bigIntToFloat(val *big.Int) float64 {
+	if val == nil {
+		return 0
+	}
+	f := new(big.Float).SetInt(val)
+	div := big.NewFloat(1e18)
+	result, _ := new(big.Float).Quo(f, div).Float64()
+	return result
+}
+
+// calculateNLTV is debt over the USD value of the collateral, using the
+// latest price cached from the price-feed subsystem (defaults to 1.0 before
+// any PriceFeedUpdated event has been seen, preserving the original
+// debt/collateral ratio).
+func calculateNLTV(debt, collateral float64) float64 {
+	price := currentPrice()
+	if collateral == 0 || price == 0 {
+		return 0
+	}
+	return math.Round((debt/(collateral*price))*10000) / 100
+}
+
+func getTxType(op uint8) string {
+	switch op {
+	case 0:
+		return "openTrove"
+	case 1:
+		return "closeTrove"
+	case 2:
+		return "adjustTrove"
+	default:
+		return "unknown"
+	}
+}
+
+func getNextPositionID() int {
+	opts := options.FindOne().SetSort(bson.D{{Key: "positionID", Value: -1}})
+	var last Position
+	err := positionColl.FindOne(context.TODO(), bson.D{}, opts).Decode(&last)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return 1
+		}
+		log.Fatalf("failed to fetch latest positionID: %v", err)
+	}
+	return last.PositionID + 1
+}
+
+// ------------------ Position Updater ------------------
+
+// handlePositionUpdate applies a TroveUpdated event to PositionIndexer and
+// returns the resulting position plus its NLTV before this update (0 for a
+// brand-new position), so callers can detect risk-bucket transitions.
+func handlePositionUpdate(wallet, asset, op string, collateral, debt float64, history HistoryEntry, blockNumber uint64) (Position, float64, error) {
+	// Idempotency guard: a resumed backfill or a reconnect replaying the
+	// same block range must not double-apply a txHash we've already seen.
+	dupCount, err := positionColl.CountDocuments(context.TODO(), bson.M{
+		"history": bson.M{"$elemMatch": bson.M{"txHash": history.TxHash, "blockNumber": history.BlockNumber}},
+	})
+	if err == nil && dupCount > 0 {
+		return Position{}, 0, errDuplicateHistoryEntry
+	}
+
+	nltv := calculateNLTV(debt, collateral)
+
+	if op == "openTrove" {
+		positionID := getNextPositionID()
+		pos := Position{
+			PositionID:    positionID,
+			WalletAddress: wallet,
+			Asset:         asset,
+			Coll:          collateral,
+			Debt:          debt,
+			Nltv:          nltv,
+			Status:        "active",
+			BlockNumber:   blockNumber,
+			History:       []HistoryEntry{history},
+		}
+
+		// Checkpoint the pre-image (i.e. "didn't exist") so a reorg that
+		// un-does this openTrove can delete the position again.
+		if err := saveCheckpoint(positionID, blockNumber, false, Position{}); err != nil {
+			log.Printf("⚠️ Failed to checkpoint new position %d: %v", positionID, err)
+		}
+
+		if _, err := positionColl.InsertOne(context.TODO(), pos); err != nil {
+			return Position{}, 0, err
+		}
+		return pos, 0, nil
+	}
+
+	// Update existing position
+	filter := bson.M{"walletAddress": wallet, "asset": asset, "status": "active"}
+	var latest Position
+	err = positionColl.FindOne(context.TODO(), filter).Decode(&latest)
+	if err != nil {
+		return Position{}, 0, err
+	}
+
+	if err := saveCheckpoint(latest.PositionID, blockNumber, true, latest); err != nil {
+		log.Printf("⚠️ Failed to checkpoint position %d before update: %v", latest.PositionID, err)
+	}
+
+	status := "active"
+	if op == "closeTrove" {
+		status = "closed"
+	} else if debt == 0 {
+		status = "liquidated"
+	}
+
+	update := bson.M{
+		"$set": bson.M{
+			"coll":        collateral,
+			"debt":        debt,
+			"nltv":        nltv,
+			"status":      status,
+			"blockNumber": blockNumber,
+		},
+		"$push": bson.M{"history": history},
+	}
+
+	if _, err := positionColl.UpdateOne(context.TODO(), bson.M{"positionID": latest.PositionID}, update); err != nil {
+		return Position{}, 0, err
+	}
+
+	latest.Coll = collateral
+	latest.Debt = debt
+	latest.Status = status
+	latest.BlockNumber = blockNumber
+	latest.History = append(latest.History, history)
+	updated := latest
+	updated.Nltv = nltv
+
+	return updated, latest.Nltv, nil
+}
+
+// ------------------ Subsystem ------------------
+
+// TroveSubsystem owns TroveManager + BorrowerOperations and keeps
+// PositionIndexer/PositionHistory up to date from their TroveUpdated events.
+type TroveSubsystem struct {
+	troveManager common.Address
+	borrowOps    common.Address
+	abi          abi.ABI
+}
+
+// NewTroveSubsystem loads both contracts' ABIs and merges their event sets.
+func NewTroveSubsystem() (*TroveSubsystem, error) {
+	troveABI, err := abi.JSON(strings.NewReader(loadABI("abi/TroveManager.json")))
+	if err != nil {
+		return nil, err
+	}
+
+	borrowOpsABI, err := abi.JSON(strings.NewReader(loadABI("abi/BorrowOperations.json")))
+	if err != nil {
+		return nil, err
+	}
+
+	mergedABI, err := mergeEvents(troveABI, borrowOpsABI)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TroveSubsystem{
+		troveManager: common.HexToAddress("0xE5d2644bE06c5b5d48b42AA7f9EAf27f0bC84265"),
+		borrowOps:    common.HexToAddress("0x165fB19121ab4f74dC66C520866B9Ef4EB86AFf8"),
+		abi:          mergedABI,
+	}, nil
+}
+
+func (t *TroveSubsystem) Name() string { return "trove" }
+
+func (t *TroveSubsystem) Addresses() []common.Address {
+	return []common.Address{t.troveManager, t.borrowOps}
+}
+
+func (t *TroveSubsystem) ABI() abi.ABI { return t.abi }
+
+func (t *TroveSubsystem) Handle(ev ContractEvent) error {
+	if ev.Name != "TroveUpdated" {
+		return nil
+	}
+
+	coll := bigIntToFloat(ev.Data["_coll"].(*big.Int))
+	debt := bigIntToFloat(ev.Data["_debt"].(*big.Int))
+	op := getTxType(ev.Data["_operation"].(uint8))
+
+	var wallet, asset string
+	if len(ev.RawLog.Topics) > 1 {
+		wallet = strings.ToLower(common.HexToAddress(ev.RawLog.Topics[1].Hex()).Hex())
+	}
+	if len(ev.RawLog.Topics) > 2 {
+		asset = strings.ToLower(common.HexToAddress(ev.RawLog.Topics[2].Hex()).Hex())
+	}
+
+	log.Printf("Decoded TroveUpdated → wallet=%s | asset=%s | coll=%.4f | debt=%.4f | op=%s | topics=%d",
+		wallet, asset, coll, debt, op, len(ev.RawLog.Topics))
+
+	history := HistoryEntry{
+		TxHash:      ev.RawLog.TxHash.Hex(),
+		Coll:        coll,
+		Debt:        debt,
+		TxType:      op,
+		Timestamp:   time.Now().Format(time.RFC3339),
+		BlockNumber: ev.RawLog.BlockNumber,
+	}
+
+	pos, prevNltv, err := handlePositionUpdate(wallet, asset, op, coll, debt, history, ev.RawLog.BlockNumber)
+	if errors.Is(err, errDuplicateHistoryEntry) {
+		log.Printf("⏭️ Skipping already-applied TroveUpdated: tx=%s block=%d", ev.RawLog.TxHash.Hex(), ev.RawLog.BlockNumber)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	log.Printf("✅ Position updated: %s | Coll: %.2f | Debt: %.2f | NLTV: %.2f%%", wallet, coll, debt, pos.Nltv)
+	recordRiskTransition(pos, classifyRisk(prevNltv), classifyRisk(pos.Nltv), ev.RawLog.TxHash.Hex())
+	return nil
+}